@@ -0,0 +1,141 @@
+package polling
+
+import (
+	"context"
+	"fmt"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+	bpconfig "github.com/weaveworks/tf-controller/internal/config"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	infrav1 "github.com/weaveworks/tf-controller/api/v1alpha2"
+)
+
+// planningFinalizer is set on branch/PR Terraform and GitRepository clones.
+// On a Terraform clone it blocks removal until Reconcile has torn down its
+// dependents in order; on a GitRepository clone reconcileSourceCleanup
+// releases it.
+const planningFinalizer = "branch-planner.tf-controller/finalizer"
+
+// managedByBranchPlanner selects objects carrying the branch planner's own
+// labels, so this reconciler never touches a tenant's Terraform/GitRepository.
+func managedByBranchPlanner() predicate.Predicate {
+	return predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return obj.GetLabels()[bpconfig.LabelKey] == bpconfig.LabelValue
+	})
+}
+
+// SetupWithManager registers the branch planner's field indexes and cleanup
+// reconcilers.
+func (s *Server) SetupWithManager(mgr ctrl.Manager) error {
+	if err := SetupIndexesWithManager(mgr); err != nil {
+		return err
+	}
+
+	if err := ctrl.NewControllerManagedBy(mgr).
+		For(&infrav1.Terraform{}, ctrl.WithPredicates(managedByBranchPlanner())).
+		Named("branch-planner-terraform-cleanup").
+		Complete(s); err != nil {
+		return fmt.Errorf("unable to set up Terraform cleanup reconciler: %w", err)
+	}
+
+	if err := ctrl.NewControllerManagedBy(mgr).
+		For(&sourcev1.GitRepository{}, ctrl.WithPredicates(managedByBranchPlanner())).
+		Named("branch-planner-source-cleanup").
+		Complete(reconcile.Func(s.reconcileSourceCleanup)); err != nil {
+		return fmt.Errorf("unable to set up Source cleanup reconciler: %w", err)
+	}
+
+	return nil
+}
+
+// Reconcile tears down a Terraform clone's Source and output Secret once it
+// is marked for deletion, then releases the finalizer.
+func (s *Server) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	tf := &infrav1.Terraform{}
+	if err := s.clusterClient.Get(ctx, req.NamespacedName, tf); err != nil {
+		if apierrors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+
+		return reconcile.Result{}, fmt.Errorf("unable to get Terraform %s: %w", req.NamespacedName, err)
+	}
+
+	if tf.GetDeletionTimestamp().IsZero() {
+		return reconcile.Result{}, nil
+	}
+
+	if !controllerutil.ContainsFinalizer(tf, planningFinalizer) {
+		return reconcile.Result{}, nil
+	}
+
+	if err := s.teardownTerraform(ctx, tf); err != nil {
+		return reconcile.Result{}, fmt.Errorf("unable to tear down Terraform %s: %w", req.NamespacedName, err)
+	}
+
+	controllerutil.RemoveFinalizer(tf, planningFinalizer)
+	if err := s.clusterClient.Update(ctx, tf); err != nil {
+		return reconcile.Result{}, fmt.Errorf("unable to remove finalizer from Terraform %s: %w", req.NamespacedName, err)
+	}
+
+	return reconcile.Result{}, nil
+}
+
+// reconcileSourceCleanup releases the finalizer on a cloned GitRepository
+// once it has been marked for deletion, whether by teardownTerraform or
+// directly.
+func (s *Server) reconcileSourceCleanup(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	source := &sourcev1.GitRepository{}
+	if err := s.clusterClient.Get(ctx, req.NamespacedName, source); err != nil {
+		if apierrors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+
+		return reconcile.Result{}, fmt.Errorf("unable to get Source %s: %w", req.NamespacedName, err)
+	}
+
+	if source.GetDeletionTimestamp().IsZero() || !controllerutil.ContainsFinalizer(source, planningFinalizer) {
+		return reconcile.Result{}, nil
+	}
+
+	controllerutil.RemoveFinalizer(source, planningFinalizer)
+	if err := s.clusterClient.Update(ctx, source); err != nil {
+		return reconcile.Result{}, fmt.Errorf("unable to remove finalizer from Source %s: %w", req.NamespacedName, err)
+	}
+
+	return reconcile.Result{}, nil
+}
+
+// teardownTerraform deletes a clone's Source, then its output Secret if it
+// has one. Both steps tolerate the target already being gone, so a retry
+// after a partial failure is safe.
+func (s *Server) teardownTerraform(ctx context.Context, tf *infrav1.Terraform) error {
+	if err := s.deleteSource(ctx, tf); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("unable to delete Source for Terraform %s: %w", client.ObjectKeyFromObject(tf), err)
+	}
+
+	if tf.Spec.WriteOutputsToSecret != nil {
+		secretRef := client.ObjectKey{
+			Namespace: tf.Namespace,
+			Name:      tf.Spec.WriteOutputsToSecret.Name,
+		}
+
+		secret, err := s.getSecret(ctx, secretRef)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("unable to get output Secret %s: %w", secretRef, err)
+		}
+
+		if secret != nil {
+			if err := s.clusterClient.Delete(ctx, secret); err != nil && !apierrors.IsNotFound(err) {
+				return fmt.Errorf("unable to delete output Secret %s: %w", secretRef, err)
+			}
+		}
+	}
+
+	return nil
+}
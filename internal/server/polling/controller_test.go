@@ -0,0 +1,59 @@
+package polling
+
+import (
+	"context"
+	"testing"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	infrav1 "github.com/weaveworks/tf-controller/api/v1alpha2"
+)
+
+func TestTeardownTerraformDeletesSourceAndSecret(t *testing.T) {
+	scheme := runtime.NewScheme()
+	for _, add := range []func(*runtime.Scheme) error{infrav1.AddToScheme, sourcev1.AddToScheme, corev1.AddToScheme} {
+		if err := add(scheme); err != nil {
+			t.Fatalf("unable to add scheme: %v", err)
+		}
+	}
+
+	source := &sourcev1.GitRepository{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-feature-42", Namespace: "tenant"},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-feature-42-outputs", Namespace: "tenant"},
+	}
+	tf := &infrav1.Terraform{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-feature-42", Namespace: "tenant"},
+		Spec: infrav1.TerraformSpec{
+			SourceRef: infrav1.CrossNamespaceSourceReference{
+				Kind:      sourcev1.GitRepositoryKind,
+				Name:      source.Name,
+				Namespace: source.Namespace,
+			},
+			WriteOutputsToSecret: &infrav1.WriteOutputsToSecretSpec{Name: secret.Name},
+		},
+	}
+
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(source, secret, tf).Build()
+	s := NewServer(cl, logr.Discard(), false)
+
+	if err := s.teardownTerraform(context.Background(), tf); err != nil {
+		t.Fatalf("teardownTerraform() error = %v", err)
+	}
+
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(source), &sourcev1.GitRepository{}); !apierrors.IsNotFound(err) {
+		t.Errorf("Source still exists after teardownTerraform(): err = %v", err)
+	}
+
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(secret), &corev1.Secret{}); !apierrors.IsNotFound(err) {
+		t.Errorf("output Secret still exists after teardownTerraform(): err = %v", err)
+	}
+}
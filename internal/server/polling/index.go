@@ -0,0 +1,70 @@
+package polling
+
+import (
+	"context"
+	"fmt"
+
+	bpconfig "github.com/weaveworks/tf-controller/internal/config"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	infrav1 "github.com/weaveworks/tf-controller/api/v1alpha2"
+)
+
+// Field index keys registered by SetupIndexesWithManager.
+// getTerraformObjectsForPR queries the primaryResource one.
+const (
+	terraformPrimaryResourceIndexKey = ".metadata.labels." + bpconfig.LabelPrimaryResourceKey
+	terraformPRIDIndexKey            = ".metadata.labels." + bpconfig.LabelPRIDKey
+)
+
+// SetupIndexesWithManager registers the field indexes used to look up a
+// Terraform clone by (primaryResource, prID). Must run before the manager's
+// cache starts.
+func SetupIndexesWithManager(mgr manager.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &infrav1.Terraform{}, terraformPrimaryResourceIndexKey, func(obj client.Object) []string {
+		if v, ok := obj.GetLabels()[bpconfig.LabelPrimaryResourceKey]; ok {
+			return []string{v}
+		}
+
+		return nil
+	}); err != nil {
+		return fmt.Errorf("unable to index Terraform by %s label: %w", bpconfig.LabelPrimaryResourceKey, err)
+	}
+
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &infrav1.Terraform{}, terraformPRIDIndexKey, func(obj client.Object) []string {
+		if v, ok := obj.GetLabels()[bpconfig.LabelPRIDKey]; ok {
+			return []string{v}
+		}
+
+		return nil
+	}); err != nil {
+		return fmt.Errorf("unable to index Terraform by %s label: %w", bpconfig.LabelPRIDKey, err)
+	}
+
+	return nil
+}
+
+// getTerraformObjectsForPR returns the Terraform clones for a single PR of a
+// single primary resource. The cache-backed client only supports a single
+// exact-match field requirement per List, so this narrows by the
+// primaryResource index and then filters the (normally tiny) result down to
+// the matching PR ID in Go.
+func (s *Server) getTerraformObjectsForPR(ctx context.Context, namespace string, primaryResource string, prID string) ([]*infrav1.Terraform, error) {
+	tfList := &infrav1.TerraformList{}
+	if err := s.clusterClient.List(ctx, tfList,
+		client.InNamespace(namespace),
+		client.MatchingFields{terraformPrimaryResourceIndexKey: primaryResource},
+	); err != nil {
+		return nil, fmt.Errorf("unable to list Terraform objects for primary resource %s: %w", primaryResource, err)
+	}
+
+	result := make([]*infrav1.Terraform, 0, len(tfList.Items))
+	for i := range tfList.Items {
+		if tfList.Items[i].Labels[bpconfig.LabelPRIDKey] == prID {
+			result = append(result, &tfList.Items[i])
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,72 @@
+package polling
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	bpconfig "github.com/weaveworks/tf-controller/internal/config"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	infrav1 "github.com/weaveworks/tf-controller/api/v1alpha2"
+)
+
+func TestGetTerraformObjectsForPR(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := infrav1.AddToScheme(scheme); err != nil {
+		t.Fatalf("unable to add scheme: %v", err)
+	}
+
+	want := &infrav1.Terraform{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app-main-42",
+			Namespace: "tenant",
+			Labels: map[string]string{
+				bpconfig.LabelPrimaryResourceKey: "app",
+				bpconfig.LabelPRIDKey:            "42",
+			},
+		},
+	}
+	otherPR := &infrav1.Terraform{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app-feature-7",
+			Namespace: "tenant",
+			Labels: map[string]string{
+				bpconfig.LabelPrimaryResourceKey: "app",
+				bpconfig.LabelPRIDKey:            "7",
+			},
+		},
+	}
+	otherResource := &infrav1.Terraform{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "other-main-42",
+			Namespace: "tenant",
+			Labels: map[string]string{
+				bpconfig.LabelPrimaryResourceKey: "other",
+				bpconfig.LabelPRIDKey:            "42",
+			},
+		},
+	}
+
+	cl := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithIndex(&infrav1.Terraform{}, terraformPrimaryResourceIndexKey, func(obj client.Object) []string {
+			return []string{obj.GetLabels()[bpconfig.LabelPrimaryResourceKey]}
+		}).
+		WithObjects(want, otherPR, otherResource).
+		Build()
+
+	s := NewServer(cl, logr.Discard(), false)
+
+	got, err := s.getTerraformObjectsForPR(context.Background(), "tenant", "app", "42")
+	if err != nil {
+		t.Fatalf("getTerraformObjectsForPR() error = %v", err)
+	}
+
+	if len(got) != 1 || got[0].Name != want.Name {
+		t.Fatalf("getTerraformObjectsForPR() = %v, want [%s]", got, want.Name)
+	}
+}
@@ -0,0 +1,112 @@
+package polling
+
+import (
+	"os"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Server runs the branch/PR-scoped Terraform planner: for each open
+// branch/PR on a primary Terraform resource it clones the resource's Source
+// and spec, and tears the clone down once the branch/PR closes.
+type Server struct {
+	clusterClient        client.Client
+	log                  logr.Logger
+	noCrossNamespaceRefs bool
+
+	// useControllerNamespace centralizes branch/PR clones into
+	// controllerNamespace instead of each tenant's own namespace.
+	useControllerNamespace bool
+	// controllerNamespace is where clones land when useControllerNamespace
+	// is set.
+	controllerNamespace string
+
+	// listPageSize bounds how many Terraform objects listTerraformObjects
+	// fetches per page.
+	listPageSize int64
+
+	// ociRefField and bucketPrefixField name the PR-metadata fields that map
+	// to an OCIRepository tag and a Bucket prefix.
+	ociRefField       string
+	bucketPrefixField string
+	// tagField names the PR-metadata field used for RefStrategyTag.
+	tagField string
+
+	// refStrategyBySource overrides the RefStrategy per source by name;
+	// sources not listed default to RefStrategyBranch.
+	refStrategyBySource map[string]RefStrategy
+}
+
+// ServerOption configures a Server built by NewServer.
+type ServerOption func(*Server)
+
+// WithControllerNamespace centralizes branch/PR clones into namespace
+// instead of each tenant's own namespace. An empty namespace falls back to
+// the POD_NAMESPACE environment variable; if that's also unset, centralized
+// mode stays off.
+func WithControllerNamespace(namespace string) ServerOption {
+	return func(s *Server) {
+		if namespace == "" {
+			namespace = os.Getenv("POD_NAMESPACE")
+		}
+
+		s.useControllerNamespace = namespace != ""
+		s.controllerNamespace = namespace
+	}
+}
+
+// WithListPageSize overrides how many Terraform objects listTerraformObjects
+// fetches per page.
+func WithListPageSize(pageSize int64) ServerOption {
+	return func(s *Server) {
+		s.listPageSize = pageSize
+	}
+}
+
+// WithOCIRefField names the PR-metadata field that maps to an OCIRepository
+// clone's tag.
+func WithOCIRefField(field string) ServerOption {
+	return func(s *Server) {
+		s.ociRefField = field
+	}
+}
+
+// WithBucketPrefixField names the PR-metadata field that maps to a Bucket
+// clone's prefix.
+func WithBucketPrefixField(field string) ServerOption {
+	return func(s *Server) {
+		s.bucketPrefixField = field
+	}
+}
+
+// WithTagField names the PR-metadata field used by sources configured with
+// RefStrategyTag.
+func WithTagField(field string) ServerOption {
+	return func(s *Server) {
+		s.tagField = field
+	}
+}
+
+// WithRefStrategy sets the RefStrategy each named source's clones resolve
+// against; sources not listed default to RefStrategyBranch.
+func WithRefStrategy(bySource map[string]RefStrategy) ServerOption {
+	return func(s *Server) {
+		s.refStrategyBySource = bySource
+	}
+}
+
+// NewServer builds a branch/PR planner Server against clusterClient.
+func NewServer(clusterClient client.Client, log logr.Logger, noCrossNamespaceRefs bool, opts ...ServerOption) *Server {
+	s := &Server{
+		clusterClient:        clusterClient,
+		log:                  log,
+		noCrossNamespaceRefs: noCrossNamespaceRefs,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
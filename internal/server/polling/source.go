@@ -0,0 +1,195 @@
+package polling
+
+import (
+	"fmt"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+	sourcev1beta2 "github.com/fluxcd/source-controller/api/v1beta2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// RefStrategy selects which field of a cloned GitRepository's
+// spec.Reference the branch planner populates from the PR event. A PR head
+// SHA is more reliable than a branch name, since force-pushes to the PR
+// branch can race a running plan, but some sources track a tag or a SemVer
+// range instead of a branch.
+type RefStrategy string
+
+const (
+	RefStrategyBranch RefStrategy = "branch"
+	RefStrategyCommit RefStrategy = "commit"
+	RefStrategyTag    RefStrategy = "tag"
+	RefStrategySemVer RefStrategy = "semver"
+)
+
+// planRef carries the PR/branch metadata needed to point a cloned source at
+// the right revision, regardless of which source kind backs it. OCIRef and
+// BucketPrefix are resolved by the caller from the branch-planner config's
+// PR-metadata field mapping, so that a planSource implementation never needs
+// to know which webhook field the operator chose to carry its revision in.
+type planRef struct {
+	Branch       string
+	PRID         string
+	OCIRef       string
+	BucketPrefix string
+
+	// Strategy selects which GitRepository.Spec.Reference field Branch/SHA/Tag
+	// is written to. Only gitPlanSource looks at this; it is ignored by the
+	// OCI/Bucket implementations.
+	Strategy RefStrategy
+	// SHA is the PR head commit, used when Strategy is RefStrategyCommit.
+	SHA string
+	// Tag is the PR's tag, used when Strategy is RefStrategyTag.
+	Tag string
+}
+
+// planSource abstracts the handful of source-controller kinds the branch
+// planner knows how to clone for PR/branch planning: GitRepository (branch
+// ref), OCIRepository (tag taken from the PR metadata; digests are not set)
+// and Bucket (prefix taken from the PR metadata). reconcileSource/deleteSource dispatch to the
+// right implementation by SourceRef.Kind, but otherwise don't need to know
+// about it; the PlanOnly/StoreReadablePlan semantics on the cloned Terraform
+// stay the same across all three.
+type planSource interface {
+	client.Object
+
+	// Ref returns the namespace/name of the wrapped object, which is the
+	// original for a planSource from getSource and the clone for one from
+	// reconcileSource.
+	Ref() client.ObjectKey
+
+	// Kind returns the source-controller kind this planSource wraps, so that
+	// a clone of the same kind as an already-fetched original can be built
+	// without re-inspecting the Terraform's SourceRef.
+	Kind() string
+
+	// configure points the receiver, a freshly fetched-or-created clone, at
+	// the branch/PR described by ref, copying over the rest of original's
+	// spec (interval, ignore rules, secret refs, etc).
+	configure(original planSource, ref planRef, interval metav1.Duration) error
+}
+
+// refStrategy looks up the configured RefStrategy for a source by name,
+// falling back to RefStrategyBranch so that sources the operator hasn't
+// configured keep today's branch-based behaviour.
+func (s *Server) refStrategy(source planSource) RefStrategy {
+	if strategy, ok := s.refStrategyBySource[source.GetName()]; ok {
+		return strategy
+	}
+
+	return RefStrategyBranch
+}
+
+// newPlanSourceForKind returns an empty planSource of the given
+// source-controller kind, ready to be populated by client.Get or
+// controllerutil.CreateOrUpdate.
+func newPlanSourceForKind(kind string) (planSource, error) {
+	switch kind {
+	case sourcev1.GitRepositoryKind:
+		return &gitPlanSource{&sourcev1.GitRepository{}}, nil
+	case sourcev1beta2.OCIRepositoryKind:
+		return &ociPlanSource{&sourcev1beta2.OCIRepository{}}, nil
+	case sourcev1beta2.BucketKind:
+		return &bucketPlanSource{&sourcev1beta2.Bucket{}}, nil
+	default:
+		return nil, fmt.Errorf("branch based planner does not support source kind: %s", kind)
+	}
+}
+
+type gitPlanSource struct {
+	*sourcev1.GitRepository
+}
+
+func (g *gitPlanSource) Ref() client.ObjectKey {
+	return client.ObjectKeyFromObject(g.GitRepository)
+}
+
+func (g *gitPlanSource) Kind() string { return sourcev1.GitRepositoryKind }
+
+func (g *gitPlanSource) configure(original planSource, ref planRef, interval metav1.Duration) error {
+	o, ok := original.(*gitPlanSource)
+	if !ok {
+		return fmt.Errorf("expected a GitRepository original, got %T", original)
+	}
+
+	spec := o.Spec.DeepCopy()
+
+	// Reference is nil for a GitRepository that relies on default-branch
+	// detection instead of setting spec.ref.
+	var origSemVer string
+	if spec.Reference != nil {
+		origSemVer = spec.Reference.SemVer
+	}
+	spec.Reference = &sourcev1.GitRepositoryRef{}
+
+	switch ref.Strategy {
+	case RefStrategyCommit:
+		spec.Reference.Commit = ref.SHA
+	case RefStrategyTag:
+		spec.Reference.Tag = ref.Tag
+	case RefStrategySemVer:
+		// SemVer is a range, not a PR-specific value, so it's carried over
+		// from the original rather than derived from ref.
+		spec.Reference.SemVer = origSemVer
+	default: // RefStrategyBranch, and any unset/unknown strategy
+		spec.Reference.Branch = ref.Branch
+	}
+
+	spec.Interval = metav1.Duration{Duration: interval.Duration}
+	g.Spec = *spec
+
+	return nil
+}
+
+type ociPlanSource struct {
+	*sourcev1beta2.OCIRepository
+}
+
+func (o *ociPlanSource) Ref() client.ObjectKey {
+	return client.ObjectKeyFromObject(o.OCIRepository)
+}
+
+func (o *ociPlanSource) Kind() string { return sourcev1beta2.OCIRepositoryKind }
+
+func (o *ociPlanSource) configure(original planSource, ref planRef, interval metav1.Duration) error {
+	orig, ok := original.(*ociPlanSource)
+	if !ok {
+		return fmt.Errorf("expected an OCIRepository original, got %T", original)
+	}
+
+	spec := orig.Spec.DeepCopy()
+	if ref.OCIRef != "" {
+		spec.Reference = &sourcev1beta2.OCIRepositoryRef{Tag: ref.OCIRef}
+	}
+	spec.Interval = metav1.Duration{Duration: interval.Duration}
+	o.Spec = *spec
+
+	return nil
+}
+
+type bucketPlanSource struct {
+	*sourcev1beta2.Bucket
+}
+
+func (b *bucketPlanSource) Ref() client.ObjectKey {
+	return client.ObjectKeyFromObject(b.Bucket)
+}
+
+func (b *bucketPlanSource) Kind() string { return sourcev1beta2.BucketKind }
+
+func (b *bucketPlanSource) configure(original planSource, ref planRef, interval metav1.Duration) error {
+	orig, ok := original.(*bucketPlanSource)
+	if !ok {
+		return fmt.Errorf("expected a Bucket original, got %T", original)
+	}
+
+	spec := orig.Spec.DeepCopy()
+	if ref.BucketPrefix != "" {
+		spec.Prefix = ref.BucketPrefix
+	}
+	spec.Interval = metav1.Duration{Duration: interval.Duration}
+	b.Spec = *spec
+
+	return nil
+}
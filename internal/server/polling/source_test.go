@@ -0,0 +1,69 @@
+package polling
+
+import (
+	"testing"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+	sourcev1beta2 "github.com/fluxcd/source-controller/api/v1beta2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNewPlanSourceForKind(t *testing.T) {
+	cases := []struct {
+		kind    string
+		wantErr bool
+	}{
+		{sourcev1.GitRepositoryKind, false},
+		{sourcev1beta2.OCIRepositoryKind, false},
+		{sourcev1beta2.BucketKind, false},
+		{"HelmRepository", true},
+	}
+
+	for _, tc := range cases {
+		source, err := newPlanSourceForKind(tc.kind)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("newPlanSourceForKind(%q) expected error, got none", tc.kind)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("newPlanSourceForKind(%q) error = %v", tc.kind, err)
+		}
+
+		if got := source.Kind(); got != tc.kind {
+			t.Errorf("newPlanSourceForKind(%q).Kind() = %q", tc.kind, got)
+		}
+	}
+}
+
+func TestGitPlanSourceConfigureNilReference(t *testing.T) {
+	original := &gitPlanSource{&sourcev1.GitRepository{}}
+	clone := &gitPlanSource{&sourcev1.GitRepository{}}
+
+	if err := clone.configure(original, planRef{Branch: "feature"}, metav1.Duration{}); err != nil {
+		t.Fatalf("configure() error = %v", err)
+	}
+
+	if clone.Spec.Reference == nil || clone.Spec.Reference.Branch != "feature" {
+		t.Fatalf("configure() = %+v, want Branch = feature", clone.Spec.Reference)
+	}
+}
+
+func TestGitPlanSourceConfigureSemVerPreserved(t *testing.T) {
+	original := &gitPlanSource{&sourcev1.GitRepository{
+		Spec: sourcev1.GitRepositorySpec{
+			Reference: &sourcev1.GitRepositoryRef{SemVer: ">=1.0.0"},
+		},
+	}}
+	clone := &gitPlanSource{&sourcev1.GitRepository{}}
+
+	if err := clone.configure(original, planRef{Strategy: RefStrategySemVer}, metav1.Duration{}); err != nil {
+		t.Fatalf("configure() error = %v", err)
+	}
+
+	if clone.Spec.Reference == nil || clone.Spec.Reference.SemVer != ">=1.0.0" {
+		t.Fatalf("configure() = %+v, want SemVer preserved", clone.Spec.Reference)
+	}
+}
@@ -6,17 +6,22 @@ import (
 	"time"
 
 	"github.com/fluxcd/pkg/runtime/acl"
-	sourcev1 "github.com/fluxcd/source-controller/api/v1"
 	bpconfig "github.com/weaveworks/tf-controller/internal/config"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	k8sLabels "k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/pager"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 
 	infrav1 "github.com/weaveworks/tf-controller/api/v1alpha2"
 )
 
+// defaultListPageSize is used when the Server has no page size configured
+// through WithListPageSize.
+const defaultListPageSize = 500
+
 func (s *Server) getTerraformObject(ctx context.Context, ref client.ObjectKey) (*infrav1.Terraform, error) {
 	obj := &infrav1.Terraform{}
 	if err := s.clusterClient.Get(ctx, ref, obj); err != nil {
@@ -26,32 +31,69 @@ func (s *Server) getTerraformObject(ctx context.Context, ref client.ObjectKey) (
 	return obj, nil
 }
 
+// listTerraformObjects pages through every Terraform object in namespace
+// matching labels, rather than issuing a single unbounded List.
 func (s *Server) listTerraformObjects(ctx context.Context, namespace string, labels map[string]string) ([]*infrav1.Terraform, error) {
-	tfList := &infrav1.TerraformList{}
+	var selector k8sLabels.Selector
+	if labels != nil {
+		selector = k8sLabels.Set(labels).AsSelector()
+	}
 
-	opts := []client.ListOption{client.InNamespace(namespace)}
+	listPager := pager.New(func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+		tfList := &infrav1.TerraformList{}
 
-	if labels != nil {
-		opts = append(opts, client.MatchingLabelsSelector{
-			Selector: k8sLabels.Set(labels).AsSelector(),
-		})
+		listOpts := []client.ListOption{client.InNamespace(namespace), &client.ListOptions{Raw: &opts}}
+		if selector != nil {
+			listOpts = append(listOpts, client.MatchingLabelsSelector{Selector: selector})
+		}
+
+		if err := s.clusterClient.List(ctx, tfList, listOpts...); err != nil {
+			return nil, err
+		}
+
+		return tfList, nil
+	})
+
+	listPager.PageSize = s.listPageSize
+	if listPager.PageSize == 0 {
+		listPager.PageSize = defaultListPageSize
 	}
 
-	if err := s.clusterClient.List(ctx, tfList, opts...); err != nil {
+	var result []*infrav1.Terraform
+	err := listPager.EachListItem(ctx, metav1.ListOptions{ResourceVersion: "0"}, func(obj runtime.Object) error {
+		tf, ok := obj.(*infrav1.Terraform)
+		if !ok {
+			return fmt.Errorf("unexpected object type %T in Terraform page", obj)
+		}
+
+		result = append(result, tf)
+
+		return nil
+	})
+	if err != nil {
 		return nil, fmt.Errorf("unable to list Terraform objects: %w", err)
 	}
 
-	result := make([]*infrav1.Terraform, len(tfList.Items))
-	for i := range tfList.Items {
-		result[i] = &tfList.Items[i]
+	return result, nil
+}
+
+// resourcePlanningNamespace returns the namespace that branch/PR-scoped clones
+// should be created in. When the server is running in controller-namespace
+// mode (WithControllerNamespace / POD_NAMESPACE), clones are centralized into
+// the controller's own namespace instead of the tenant namespace, so that the
+// controller never needs write access across every tenant namespace.
+func (s *Server) resourcePlanningNamespace(tenantNamespace string) string {
+	if s.useControllerNamespace && s.controllerNamespace != "" {
+		return s.controllerNamespace
 	}
 
-	return result, nil
+	return tenantNamespace
 }
 
-func (s *Server) getSource(ctx context.Context, tf *infrav1.Terraform) (*sourcev1.GitRepository, error) {
-	if tf.Spec.SourceRef.Kind != sourcev1.GitRepositoryKind {
-		return nil, fmt.Errorf("branch based planner does not support source kind: %s", tf.Spec.SourceRef.Kind)
+func (s *Server) getSource(ctx context.Context, tf *infrav1.Terraform) (planSource, error) {
+	source, err := newPlanSourceForKind(tf.Spec.SourceRef.Kind)
+	if err != nil {
+		return nil, err
 	}
 
 	ref := client.ObjectKey{
@@ -69,18 +111,27 @@ func (s *Server) getSource(ctx context.Context, tf *infrav1.Terraform) (*sourcev
 		)
 	}
 
-	obj := &sourcev1.GitRepository{}
-	if err := s.clusterClient.Get(ctx, ref, obj); err != nil {
+	if err := s.clusterClient.Get(ctx, ref, source); err != nil {
 		return nil, fmt.Errorf("unable to get Source: %w", err)
 	}
 
-	return obj, nil
+	return source, nil
 }
 
-func (s *Server) reconcileTerraform(ctx context.Context, originalTF *infrav1.Terraform, originalSource *sourcev1.GitRepository, branch string, prID string, interval time.Duration) error {
-	tfName := s.createObjectName(originalTF.Name, branch, prID)
-	msg := fmt.Sprintf("Terraform object %s in the namespace %s", tfName, originalTF.Namespace)
-	source, err := s.reconcileSource(ctx, originalSource, branch, prID, interval)
+func (s *Server) reconcileTerraform(ctx context.Context, originalTF *infrav1.Terraform, originalSource planSource, branch string, prID string, sha string, prMetadata map[string]string, interval time.Duration) error {
+	planningNamespace := s.resourcePlanningNamespace(originalTF.Namespace)
+	tfName := s.createObjectName(originalTF.Name, originalTF.Namespace, branch, prID)
+	msg := fmt.Sprintf("Terraform object %s in the namespace %s", tfName, planningNamespace)
+	ref := planRef{
+		Branch:       branch,
+		PRID:         prID,
+		OCIRef:       prMetadata[s.ociRefField],
+		BucketPrefix: prMetadata[s.bucketPrefixField],
+		Strategy:     s.refStrategy(originalSource),
+		SHA:          sha,
+		Tag:          prMetadata[s.tagField],
+	}
+	source, err := s.reconcileSource(ctx, originalSource, planningNamespace, ref, interval)
 	if err != nil {
 		return fmt.Errorf("unable to reconcile Source for %s: %w", msg, err)
 	}
@@ -88,7 +139,7 @@ func (s *Server) reconcileTerraform(ctx context.Context, originalTF *infrav1.Ter
 	tf := &infrav1.Terraform{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      tfName,
-			Namespace: originalTF.Namespace,
+			Namespace: planningNamespace,
 		},
 	}
 
@@ -96,13 +147,13 @@ func (s *Server) reconcileTerraform(ctx context.Context, originalTF *infrav1.Ter
 	op, err := controllerutil.CreateOrUpdate(ctx, s.clusterClient, tf, func() error {
 		spec := originalTF.Spec.DeepCopy()
 
-		spec.SourceRef.Name = source.Name
-		spec.SourceRef.Namespace = source.Namespace
+		spec.SourceRef.Name = source.GetName()
+		spec.SourceRef.Namespace = source.GetNamespace()
 		spec.PlanOnly = true
 		spec.StoreReadablePlan = "human"
 		// relocate the output secret, so it's not shared between branches
 		if spec.WriteOutputsToSecret != nil && originalTF.Spec.WriteOutputsToSecret != nil {
-			spec.WriteOutputsToSecret.Name = s.createObjectName(originalTF.Spec.WriteOutputsToSecret.Name, branch, prID)
+			spec.WriteOutputsToSecret.Name = s.createObjectName(originalTF.Spec.WriteOutputsToSecret.Name, originalTF.Namespace, branch, prID)
 		}
 		spec.ApprovePlan = ""
 		spec.Force = false
@@ -110,6 +161,7 @@ func (s *Server) reconcileTerraform(ctx context.Context, originalTF *infrav1.Ter
 		tf.Spec = *spec
 
 		tf.SetLabels(branchLabels)
+		controllerutil.AddFinalizer(tf, planningFinalizer)
 
 		return nil
 	})
@@ -122,31 +174,27 @@ func (s *Server) reconcileTerraform(ctx context.Context, originalTF *infrav1.Ter
 	return nil
 }
 
-func (s *Server) reconcileSource(ctx context.Context, originalSource *sourcev1.GitRepository, branch string, prID string, interval time.Duration) (*sourcev1.GitRepository, error) {
-	sourceName := s.createObjectName(originalSource.Name, branch, prID)
-	msg := fmt.Sprintf("Source %s in the namespace %s", sourceName, originalSource.Namespace)
-	source := &sourcev1.GitRepository{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      sourceName,
-			Namespace: originalSource.Namespace,
-		},
-		Spec: originalSource.Spec,
+func (s *Server) reconcileSource(ctx context.Context, originalSource planSource, planningNamespace string, ref planRef, interval time.Duration) (planSource, error) {
+	sourceName := s.createObjectName(originalSource.GetName(), originalSource.GetNamespace(), ref.Branch, ref.PRID)
+	msg := fmt.Sprintf("Source %s in the namespace %s", sourceName, planningNamespace)
+	source, err := newPlanSourceForKind(originalSource.Kind())
+	if err != nil {
+		return nil, err
 	}
-	branchLabels := s.createLabels(originalSource.Labels, originalSource.Name, branch, prID)
+	source.SetName(sourceName)
+	source.SetNamespace(planningNamespace)
+
+	branchLabels := s.createLabels(originalSource.GetLabels(), originalSource.GetName(), ref.Branch, ref.PRID)
 
 	op, err := controllerutil.CreateOrUpdate(ctx, s.clusterClient, source, func() error {
 		source.SetLabels(branchLabels)
-
-		spec := originalSource.Spec.DeepCopy()
-
-		spec.Reference.Branch = branch
-		spec.Interval = metav1.Duration{
-			Duration: interval,
+		// Only GitRepository clones have a reconciler that releases
+		// planningFinalizer.
+		if _, ok := source.(*gitPlanSource); ok {
+			controllerutil.AddFinalizer(source, planningFinalizer)
 		}
 
-		source.Spec = *spec
-
-		return nil
+		return source.configure(originalSource, ref, metav1.Duration{Duration: interval})
 	})
 	if err != nil {
 		return nil, fmt.Errorf("reconcile failed for %s: %w", msg, err)
@@ -157,7 +205,16 @@ func (s *Server) reconcileSource(ctx context.Context, originalSource *sourcev1.G
 	return source, nil
 }
 
-func (s *Server) createObjectName(name string, branch string, prID string) string {
+// createObjectName derives the name of a branch/PR-scoped clone. When clones
+// are centralized into the controller namespace (WithControllerNamespace), the
+// source namespace is folded into the name so that identically-named
+// Terraform/GitRepository objects from different tenant namespaces don't
+// collide once they land in the same namespace.
+func (s *Server) createObjectName(name string, sourceNamespace string, branch string, prID string) string {
+	if s.useControllerNamespace {
+		return fmt.Sprintf("%s-%s-%s-%s", name, sourceNamespace, branch, prID)
+	}
+
 	return fmt.Sprintf("%s-%s-%s", name, branch, prID)
 }
 
@@ -173,18 +230,19 @@ func (s *Server) createLabels(labels map[string]string, originalName string, bra
 	return labels
 }
 
+// deleteTerraform marks a branch/PR clone for deletion. Because the clone
+// carries planningFinalizer, this only sets its DeletionTimestamp; the actual
+// teardown of its Source and output Secret, and the release of the
+// finalizer, happens asynchronously in Reconcile so that it survives a
+// controller restart partway through.
 func (s *Server) deleteTerraform(ctx context.Context, tf *infrav1.Terraform) error {
 	msg := fmt.Sprintf("Terraform %s in the namespace %s", tf.Name, tf.Namespace)
 
-	if err := s.deleteSource(ctx, tf); err != nil {
-		s.log.Error(err, fmt.Sprintf("unable to delete Source for %s", msg))
-	}
-
 	if err := s.clusterClient.Delete(ctx, tf); err != nil {
 		return fmt.Errorf("unable to delete %s: %w", msg, err)
 	}
 
-	s.log.Info(fmt.Sprintf("deleted %s", msg))
+	s.log.Info(fmt.Sprintf("marked %s for deletion", msg))
 
 	return nil
 }
@@ -195,7 +253,7 @@ func (s *Server) deleteSource(ctx context.Context, tf *infrav1.Terraform) error
 		return fmt.Errorf("unable to get Source for Terraform %s in the namespace %s: %w", tf.Name, tf.Namespace, err)
 	}
 
-	msg := fmt.Sprintf("Source %s in the namespace %s", source.Name, source.Namespace)
+	msg := fmt.Sprintf("Source %s in the namespace %s", source.GetName(), source.GetNamespace())
 
 	if err := s.clusterClient.Delete(ctx, source); err != nil {
 		return fmt.Errorf("unable to delete %s: %w", msg, err)
@@ -0,0 +1,43 @@
+package polling
+
+import "testing"
+
+func TestResourcePlanningNamespace(t *testing.T) {
+	cases := []struct {
+		name                   string
+		useControllerNamespace bool
+		controllerNamespace    string
+		tenantNamespace        string
+		want                   string
+	}{
+		{"centralized mode off", false, "flux-system", "tenant-a", "tenant-a"},
+		{"centralized mode on", true, "flux-system", "tenant-a", "flux-system"},
+		{"centralized mode on but unconfigured", true, "", "tenant-a", "tenant-a"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &Server{
+				useControllerNamespace: tc.useControllerNamespace,
+				controllerNamespace:    tc.controllerNamespace,
+			}
+
+			if got := s.resourcePlanningNamespace(tc.tenantNamespace); got != tc.want {
+				t.Errorf("resourcePlanningNamespace() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCreateObjectName(t *testing.T) {
+	s := &Server{}
+
+	if got, want := s.createObjectName("app", "tenant-a", "feature", "42"), "app-feature-42"; got != want {
+		t.Errorf("createObjectName() = %q, want %q", got, want)
+	}
+
+	s.useControllerNamespace = true
+	if got, want := s.createObjectName("app", "tenant-a", "feature", "42"), "app-tenant-a-feature-42"; got != want {
+		t.Errorf("createObjectName() with centralized mode = %q, want %q", got, want)
+	}
+}